@@ -0,0 +1,102 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// defaultCrashLogName is the crash log path used until SetCrashLogPath
+	// replaces it, mirroring upstream Terraform's "crash.log" convention.
+	defaultCrashLogName = "crash.log"
+
+	// crashRingBufferLines bounds the amount of recent log output kept in
+	// memory for a crash dump. Terraform's own panicwrap tail is similarly
+	// bounded; we don't need more than enough context to diagnose a panic.
+	crashRingBufferLines = 512
+)
+
+var (
+	crashLogPathMu sync.Mutex
+	crashLogPath   = defaultCrashLogName
+)
+
+// SetCrashLogPath changes the file that crash dumps are written to when an
+// embedded Terraform invocation panics. The default is "crash.log" in the
+// process's current working directory.
+func SetCrashLogPath(path string) {
+	crashLogPathMu.Lock()
+	defer crashLogPathMu.Unlock()
+	crashLogPath = path
+}
+
+func getCrashLogPath() string {
+	crashLogPathMu.Lock()
+	defer crashLogPathMu.Unlock()
+	return crashLogPath
+}
+
+// crashRingBuffer is a fixed-size, concurrency-safe tail of recent log
+// lines, tee'd from the runner's log pipeline so that a panic has recent
+// context to dump even though the installer embeds Terraform in-process
+// rather than re-execing under panicwrap.
+type crashRingBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newCrashRingBuffer() *crashRingBuffer {
+	return &crashRingBuffer{lines: make([]string, crashRingBufferLines)}
+}
+
+func (b *crashRingBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// tail returns the buffered lines in chronological order.
+func (b *crashRingBuffer) tail() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	out := make([]string, 0, len(b.lines))
+	out = append(out, b.lines[b.next:]...)
+	out = append(out, b.lines[:b.next]...)
+	return out
+}
+
+// dumpCrashLog writes the buffered log tail, the Terraform version header
+// and the panic value to the configured crash log path.
+func dumpCrashLog(buf *crashRingBuffer, panicVal interface{}) error {
+	path := getCrashLogPath()
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating crash log %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "%s\n", Version())
+	fmt.Fprintf(f, "panic: %v\n\n", panicVal)
+	for _, line := range buf.tail() {
+		fmt.Fprintf(f, "%s\n", line)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	fmt.Fprintf(os.Stderr, "\nTerraform crashed. A crash log was written to %s. "+
+		"Please include this log when reporting the issue.\n", abs)
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// installAbortDumpHandler arms a signal-safe handler that flushes buf to
+// the crash log on SIGABRT, which is how plugin subprocesses (provider
+// binaries managed by go-plugin) terminate when they crash. It returns a
+// func to disarm the handler once the invocation completes normally.
+func installAbortDumpHandler(buf *crashRingBuffer) func() {
+	abortCh := make(chan os.Signal, 1)
+	signal.Notify(abortCh, syscall.SIGABRT)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-abortCh:
+			_ = dumpCrashLog(buf, "SIGABRT received from plugin subprocess")
+			// The crash log is written; restore the default disposition
+			// and re-raise so the process still aborts as an operator
+			// watching for a SIGABRT exit would expect, rather than
+			// silently continuing in a state a plugin crash left broken.
+			signal.Stop(abortCh)
+			signal.Reset(syscall.SIGABRT)
+			_ = syscall.Kill(syscall.Getpid(), syscall.SIGABRT)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		signal.Stop(abortCh)
+	}
+}
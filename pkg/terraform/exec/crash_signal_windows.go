@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package exec
+
+// installAbortDumpHandler is a no-op on Windows, which has no SIGABRT
+// equivalent for detecting plugin subprocess crashes. In-process panics
+// are still caught and dumped via the recover() in runner.
+func installAbortDumpHandler(buf *crashRingBuffer) func() {
+	return func() {}
+}
@@ -2,25 +2,23 @@
 package exec
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 
-	"github.com/hashicorp/go-plugin"
-	"github.com/hashicorp/logutils"
 	"github.com/hashicorp/terraform/command"
-	"github.com/hashicorp/terraform/helper/logging"
 	"github.com/hashicorp/terraform/version"
 	"github.com/mitchellh/cli"
 )
 
+// DefaultRunOptions is the RunOptions value used by Apply, Init and Destroy,
+// preserving the historical plain-text stderr behavior.
+var DefaultRunOptions = RunOptions{}
+
 type cmdFunc func(command.Meta) cli.Command
 
 var commands = map[string]cmdFunc{
@@ -35,72 +33,44 @@ var commands = map[string]cmdFunc{
 	},
 }
 
-func runner(cmd string, dir string, args []string, stdout, stderr io.Writer) int {
-	lf := ioutil.Discard
-	if level := logging.LogLevel(); level != "" {
-		lf = &logutils.LevelFilter{
-			Levels:   logging.ValidLevels,
-			MinLevel: logutils.LogLevel(level),
-			Writer:   stdout,
-		}
-	}
-	log.SetOutput(lf)
-	defer log.SetOutput(os.Stderr)
-
-	// Make sure we clean up any managed plugins at the end of this
-	defer plugin.CleanupClients()
-
-	sdCh, cancel := makeShutdownCh()
-	defer cancel()
-
-	meta := command.Meta{
-		Color:            false,
-		GlobalPluginDirs: globalPluginDirs(stderr),
-		Ui: &cli.BasicUi{
-			Writer:      stdout,
-			ErrorWriter: stderr,
-		},
-
-		OverrideDataDir: dir,
-
-		ShutdownCh: sdCh,
-	}
-
-	f := commands[cmd]
-
-	oldStderr := os.Stderr
-	outR, outW, err := os.Pipe()
-	if err != nil {
-		fmt.Fprintf(stderr, "error creating Pipe: %v", err)
-		return 1
-	}
-	os.Stderr = outW
-	go func() {
-		scanner := bufio.NewScanner(outR)
-		for scanner.Scan() {
-			fmt.Fprintf(lf, "%s\n", scanner.Bytes())
-		}
-	}()
-	defer func() {
-		outW.Close()
-		os.Stderr = oldStderr
-	}()
-	return f(meta).Run(args)
-}
+// defaultRunner backs the package-level Apply/Init/Destroy/Plan wrappers so
+// that existing callers keep working unchanged. Callers that need to drive
+// several invocations concurrently should construct their own Runner via
+// NewRunner instead.
+var defaultRunner = NewRunner()
 
 // Apply is wrapper around `terraform apply` subcommand.
 func Apply(datadir string, args []string, stdout, stderr io.Writer) int {
-	return runner("apply", datadir, args, stdout, stderr)
+	return defaultRunner.Apply(datadir, args, stdout, stderr)
+}
+
+// ApplyWithOptions is like Apply but allows the caller to customize log
+// capture via RunOptions, e.g. to enable structured JSON logging or to
+// receive records through a slog.Handler.
+func ApplyWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return defaultRunner.ApplyWithOptions(datadir, args, stdout, stderr, opts)
 }
 
 // Destroy is wrapper around `terraform destroy` subcommand.
 func Destroy(datadir string, args []string, stdout, stderr io.Writer) int {
-	return runner("destroy", datadir, args, stdout, stderr)
+	return defaultRunner.Destroy(datadir, args, stdout, stderr)
+}
+
+// DestroyWithOptions is like Destroy but allows the caller to customize log
+// capture via RunOptions.
+func DestroyWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return defaultRunner.DestroyWithOptions(datadir, args, stdout, stderr, opts)
 }
 
 // Init is wrapper around `terraform init` subcommand.
 func Init(datadir string, args []string, stdout, stderr io.Writer) int {
-	return runner("init", datadir, args, stdout, stderr)
+	return defaultRunner.Init(datadir, args, stdout, stderr)
+}
+
+// InitWithOptions is like Init but allows the caller to customize log
+// capture via RunOptions.
+func InitWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return defaultRunner.InitWithOptions(datadir, args, stdout, stderr, opts)
 }
 
 // Version is a wrapper around `terraform version` subcommand.
@@ -116,9 +86,16 @@ func Version() string {
 
 // makeShutdownCh creates an interrupt listener and returns a channel.
 // A message will be sent on the channel for every interrupt received.
+//
+// The returned cancel func stops delivery to this invocation's own
+// signalCh only (via signal.Stop), rather than resetting the signal
+// process-wide: signal.Reset would also tear down any other Runner's
+// handler for the same signals, which is unsafe when invocations run
+// concurrently.
 func makeShutdownCh() (<-chan struct{}, func()) {
 	resultCh := make(chan struct{})
 	signalCh := make(chan os.Signal, 4)
+	done := make(chan struct{})
 
 	handle := []os.Signal{}
 	handle = append(handle, ignoreSignals...)
@@ -127,12 +104,19 @@ func makeShutdownCh() (<-chan struct{}, func()) {
 	signal.Notify(signalCh, handle...)
 	go func() {
 		for {
-			<-signalCh
-			resultCh <- struct{}{}
+			select {
+			case <-signalCh:
+				resultCh <- struct{}{}
+			case <-done:
+				return
+			}
 		}
 	}()
 
-	return resultCh, func() { signal.Reset(handle...) }
+	return resultCh, func() {
+		signal.Stop(signalCh)
+		close(done)
+	}
 }
 
 func globalPluginDirs(stderr io.Writer) []string {
@@ -0,0 +1,217 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/logutils"
+	"github.com/hashicorp/terraform/helper/logging"
+)
+
+// logRecord is the JSON shape emitted for a single line of embedded
+// Terraform log output when structured logging is enabled.
+type logRecord struct {
+	Timestamp string            `json:"@timestamp"`
+	Level     string            `json:"@level"`
+	Module    string            `json:"@module,omitempty"`
+	Message   string            `json:"@message"`
+	Fields    map[string]string `json:"@fields,omitempty"`
+}
+
+// RunOptions controls how a Terraform invocation's log output is captured
+// and surfaced to the caller. The zero value preserves the historical
+// behavior: plain text log lines filtered by TF_LOG and written to stderr.
+type RunOptions struct {
+	// JSONLogs reconfigures the embedded Terraform logger to emit
+	// structured JSON records instead of plain text lines. It is enabled
+	// implicitly when TF_LOG_JSON is set in the environment.
+	JSONLogs bool
+
+	// LogHandler, when set, receives every log record produced during the
+	// run instead of (or in addition to, see LogHandlerOnly) the textual
+	// fallback written to stderr. This lets callers do progress reporting
+	// or machine-readable error extraction without scraping text.
+	LogHandler slog.Handler
+
+	// LogHandlerOnly suppresses the human-readable fallback written to
+	// stderr once LogHandler is set. By default both are fed.
+	LogHandlerOnly bool
+}
+
+func (o RunOptions) jsonLogsEnabled() bool {
+	if o.JSONLogs {
+		return true
+	}
+	return os.Getenv("TF_LOG_JSON") != ""
+}
+
+// logPipeline fans a line of captured log output out to the configured
+// RunOptions.LogHandler and, unless suppressed, a formatted fallback
+// writer for humans. The fallback is always the invocation's real stderr,
+// not the TF_LOG-gated logutils.LevelFilter the embedded stdlib logger
+// used to write through directly: that filter defaults to io.Discard
+// whenever TF_LOG is unset, which would otherwise silently swallow every
+// JSON record. handle still runs captured lines through the same
+// logutils.LevelFilter (see levelFilter) when TF_LOG is set, so JSONLogs
+// and LogHandler gain structured/machine-readable output without losing
+// that filtering.
+type logPipeline struct {
+	opts     RunOptions
+	fallback io.Writer
+	module   string
+	crashBuf *crashRingBuffer
+
+	// emit controls whether lines are surfaced via LogHandler/fallback at
+	// all. It's false when neither TF_LOG, JSONLogs nor a LogHandler was
+	// requested, matching the historical default of discarding Terraform's
+	// internal debug logging; lines are still tee'd into crashBuf either
+	// way so a panic has a tail to dump.
+	emit bool
+
+	// levelFilter is non-nil when TF_LOG is set, reusing the same
+	// logutils.LevelFilter the embedded logger's min-level gating has
+	// always relied on so lines below TF_LOG's level are dropped
+	// regardless of which of plain/JSON/LogHandler output is in use.
+	levelFilter *logutils.LevelFilter
+}
+
+func newLogPipeline(opts RunOptions, fallback io.Writer, module string, emit bool) *logPipeline {
+	p := &logPipeline{opts: opts, fallback: fallback, module: module, emit: emit}
+	if minLevel := logging.LogLevel(); minLevel != "" {
+		p.levelFilter = &logutils.LevelFilter{
+			Levels:   logging.ValidLevels,
+			MinLevel: logutils.LogLevel(minLevel),
+		}
+	}
+	return p
+}
+
+// handle parses a single captured log line and routes it to the handler
+// and/or fallback writer, depending on how RunOptions was configured.
+func (p *logPipeline) handle(line string) {
+	if p.crashBuf != nil {
+		p.crashBuf.add(line)
+	}
+	if !p.emit {
+		return
+	}
+	if p.levelFilter != nil && !p.levelFilter.Check([]byte(line)) {
+		return
+	}
+
+	level, msg := splitLevel(line)
+	msg, fields := parseFields(msg)
+	rec := logRecord{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Level:     level,
+		Module:    p.module,
+		Message:   msg,
+		Fields:    fields,
+	}
+
+	if p.opts.LogHandler != nil {
+		slogRec := slog.Record{
+			Time:    time.Now(),
+			Message: rec.Message,
+			Level:   slogLevel(level),
+		}
+		if len(fields) > 0 {
+			attrs := make([]slog.Attr, 0, len(fields))
+			for k, v := range fields {
+				attrs = append(attrs, slog.String(k, v))
+			}
+			slogRec.AddAttrs(attrs...)
+		}
+		_ = p.opts.LogHandler.Handle(context.Background(), slogRec)
+		if p.opts.LogHandlerOnly {
+			return
+		}
+	}
+
+	if p.opts.jsonLogsEnabled() {
+		enc := json.NewEncoder(p.fallback)
+		_ = enc.Encode(rec)
+		return
+	}
+
+	fmt.Fprintf(p.fallback, "%s\n", line)
+}
+
+// splitLevel pulls a leading `[LEVEL]` prefix (the marker logutils filters
+// on) off a log line, returning the level name and the remaining message.
+func splitLevel(line string) (level, msg string) {
+	if len(line) > 0 && line[0] == '[' {
+		if idx := indexByte(line, ']'); idx > 0 {
+			return line[1:idx], trimLeftSpace(line[idx+1:])
+		}
+	}
+	return string(logutils.LogLevel(logging.LogLevel())), line
+}
+
+// parseFields strips trailing `key=value` tokens the embedded logger
+// appends after its human-readable message (e.g. "starting plugin:
+// path=/usr/bin/terraform-provider-aws args=2") and returns them as the
+// structured @fields map, along with the message without them.
+func parseFields(msg string) (string, map[string]string) {
+	parts := strings.Fields(msg)
+	var fields map[string]string
+	i := len(parts)
+	for i > 0 {
+		key, value, ok := splitKV(parts[i-1])
+		if !ok {
+			break
+		}
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[key] = value
+		i--
+	}
+	return strings.Join(parts[:i], " "), fields
+}
+
+// splitKV splits a single "key=value" token, reporting ok=false if tok
+// doesn't look like one (no '=', or an empty key).
+func splitKV(tok string) (key, value string, ok bool) {
+	idx := indexByte(tok, '=')
+	if idx <= 0 {
+		return "", "", false
+	}
+	return tok[:idx], tok[idx+1:], true
+}
+
+func slogLevel(level string) slog.Level {
+	switch level {
+	case "TRACE", "DEBUG":
+		return slog.LevelDebug
+	case "WARN":
+		return slog.LevelWarn
+	case "ERROR":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func indexByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func trimLeftSpace(s string) string {
+	i := 0
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return s[i:]
+}
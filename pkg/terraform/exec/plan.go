@@ -0,0 +1,236 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/command"
+	"github.com/hashicorp/terraform/version"
+	"github.com/mitchellh/cli"
+)
+
+// resourcechange is a machine-readable description of what Terraform
+// intends to do to a single resource instance, modeled after the subset of
+// Terraform's own JSON plan format that the installer needs.
+type resourcechange struct {
+	// Address is the resource's absolute address, e.g.
+	// "module.foo.aws_instance.bar".
+	Address string `json:"address"`
+
+	// Type is the resource type, e.g. "aws_instance".
+	Type string `json:"type"`
+
+	// Action is "create", "update", "delete", "replace" (Terraform's
+	// delete-and-create pair) or "no-op"; any other single action Terraform
+	// reports is passed through unchanged.
+	Action string `json:"action"`
+
+	// Before and After hold the resource's attribute values prior to and
+	// following the plan, as Terraform's own plan JSON represents them.
+	// Either may be nil, e.g. Before is nil for a create.
+	Before map[string]interface{} `json:"before,omitempty"`
+	After  map[string]interface{} `json:"after,omitempty"`
+}
+
+// PlanResult is the machine-readable outcome of a `terraform plan`
+// invocation: the set of resource changes it would make, the providers it
+// consulted, and the root module's output values.
+type PlanResult struct {
+	ResourceChanges []resourcechange       `json:"resource_changes"`
+	ProviderRefs    []string               `json:"provider_refs"`
+	Outputs         map[string]interface{} `json:"outputs"`
+
+	// ExitCode is the underlying `terraform plan` exit status, preserved
+	// for callers that want to distinguish "no changes" (0), "changes
+	// present" (2) and error (1), per Terraform's -detailed-exitcode
+	// convention.
+	ExitCode int `json:"-"`
+}
+
+// HasDestructiveChanges reports whether the plan would delete or replace
+// any resource, which callers can use to gate execution and require
+// explicit confirmation before proceeding.
+func (p *PlanResult) HasDestructiveChanges() bool {
+	for _, rc := range p.ResourceChanges {
+		if rc.Action == "delete" || rc.Action == "replace" {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	commands["plan"] = func(meta command.Meta) cli.Command {
+		return &command.PlanCommand{Meta: meta}
+	}
+	commands["show"] = func(meta command.Meta) cli.Command {
+		return &command.ShowCommand{Meta: meta}
+	}
+}
+
+// Plan is a wrapper around the `terraform plan` subcommand that, in
+// addition to running the subcommand as Apply/Init/Destroy do, parses the
+// plan it produces into a structured PlanResult so that callers can
+// inspect or gate on the changes it describes without reparsing text.
+func Plan(datadir string, args []string, stdout, stderr io.Writer) (*PlanResult, int) {
+	return defaultRunner.Plan(datadir, args, stdout, stderr)
+}
+
+// PlanWithOptions is like Plan but allows the caller to customize log
+// capture via RunOptions.
+func PlanWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) (*PlanResult, int) {
+	return defaultRunner.PlanWithOptions(datadir, args, stdout, stderr, opts)
+}
+
+// planWithOptions is the Runner-bound implementation behind Plan/PlanWithOptions.
+func (r *Runner) planWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) (*PlanResult, int) {
+	if !supportsJSONPlan() {
+		fmt.Fprintf(stderr, "error: embedded terraform %s does not support `show -json`; Plan requires Terraform 0.12 or later\n", version.Version)
+		return nil, 1
+	}
+
+	planFile := filepath.Join(datadir, "installer.tfplan")
+	defer os.Remove(planFile)
+
+	runArgs := append(append([]string{}, args...), "-out="+planFile)
+	if !contains(runArgs, "-detailed-exitcode") {
+		runArgs = append(runArgs, "-detailed-exitcode")
+	}
+	code := r.run("plan", datadir, runArgs, stdout, stderr, opts, false)
+	// With -detailed-exitcode above, terraform plan exits 0 for "no
+	// changes" and 2 for "changes present"; either is a successful plan
+	// as far as PlanResult is concerned, only 1 means an actual error.
+	if code != 0 && code != 2 {
+		return nil, code
+	}
+
+	result, err := r.readPlanResult(datadir, planFile, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error reading plan result: %v\n", err)
+		return nil, 1
+	}
+	result.ExitCode = code
+	return result, code
+}
+
+// supportsJSONPlan reports whether the embedded Terraform version is new
+// enough to support `terraform show -json`, which readPlanResult relies on
+// to build a PlanResult. That flag was introduced in Terraform 0.12.
+func supportsJSONPlan() bool {
+	major, minor, ok := parseMajorMinor(version.Version)
+	if !ok {
+		// Version string didn't parse as expected; assume modern enough
+		// rather than breaking Plan on an embedded version we can't read.
+		return true
+	}
+	return major > 0 || (major == 0 && minor >= 12)
+}
+
+func parseMajorMinor(v string) (major, minor int, ok bool) {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// planShowJSON is the subset of `terraform show -json <planfile>`'s output
+// that readPlanResult needs, deliberately kept small rather than modeling
+// Terraform's entire plan schema.
+type planShowJSON struct {
+	ResourceChanges []struct {
+		Address      string `json:"address"`
+		Type         string `json:"type"`
+		ProviderName string `json:"provider_name"`
+		Change       struct {
+			Actions []string               `json:"actions"`
+			Before  map[string]interface{} `json:"before"`
+			After   map[string]interface{} `json:"after"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+	PlannedValues struct {
+		Outputs map[string]struct {
+			Value interface{} `json:"value"`
+		} `json:"outputs"`
+	} `json:"planned_values"`
+}
+
+// readPlanResult runs `terraform show -json` against the binary plan file
+// produced by a preceding `terraform plan -out=...` and converts it into a
+// PlanResult.
+func (r *Runner) readPlanResult(datadir, planFile string, stderr io.Writer) (*PlanResult, error) {
+	var out bytes.Buffer
+	code := r.run("show", datadir, []string{"-json", planFile}, &out, stderr, DefaultRunOptions, false)
+	if code != 0 {
+		return nil, fmt.Errorf("terraform show -json exited %d", code)
+	}
+
+	var raw planShowJSON
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil {
+		return nil, fmt.Errorf("parsing terraform show -json output: %w", err)
+	}
+
+	result := &PlanResult{
+		Outputs: make(map[string]interface{}, len(raw.PlannedValues.Outputs)),
+	}
+
+	providerSeen := make(map[string]bool)
+	for _, rc := range raw.ResourceChanges {
+		if rc.ProviderName != "" && !providerSeen[rc.ProviderName] {
+			providerSeen[rc.ProviderName] = true
+			result.ProviderRefs = append(result.ProviderRefs, rc.ProviderName)
+		}
+
+		result.ResourceChanges = append(result.ResourceChanges, resourcechange{
+			Address: rc.Address,
+			Type:    rc.Type,
+			Action:  planAction(rc.Change.Actions),
+			Before:  rc.Change.Before,
+			After:   rc.Change.After,
+		})
+	}
+
+	for name, v := range raw.PlannedValues.Outputs {
+		result.Outputs[name] = v.Value
+	}
+
+	return result, nil
+}
+
+// planAction collapses Terraform's action list (e.g. ["delete", "create"]
+// for a replace) down to the single action resourcechange exposes.
+func planAction(actions []string) string {
+	switch {
+	case len(actions) == 0:
+		return "no-op"
+	case len(actions) == 1:
+		return actions[0]
+	case contains(actions, "delete") && contains(actions, "create"):
+		return "replace"
+	default:
+		return actions[0]
+	}
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
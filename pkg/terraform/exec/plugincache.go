@@ -0,0 +1,126 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gofrs/flock"
+)
+
+// pluginCacheLockName is the lock file created inside the cache directory
+// to serialize concurrent writers across installer processes. It mirrors
+// the approach terraform init itself uses for its own provider lock.
+const pluginCacheLockName = ".installer-plugin-cache.lock"
+
+// pluginCacheDirMu guards pluginCacheDir, which may be read and written
+// from multiple goroutines if the caller drives concurrent Init calls.
+var (
+	pluginCacheDirMu sync.RWMutex
+	pluginCacheDir   string
+)
+
+// SetPluginCacheDir configures a shared directory that downloaded provider
+// plugins are cached in across installer runs, equivalent to Terraform's
+// TF_PLUGIN_CACHE_DIR. It takes precedence over the TF_PLUGIN_CACHE_DIR
+// environment variable. Passing "" falls back to TF_PLUGIN_CACHE_DIR; the
+// cache is disabled only when both are empty.
+func SetPluginCacheDir(dir string) {
+	pluginCacheDirMu.Lock()
+	defer pluginCacheDirMu.Unlock()
+	pluginCacheDir = dir
+}
+
+// pluginCacheDirPath returns the configured cache directory, falling back
+// to the TF_PLUGIN_CACHE_DIR environment variable.
+func pluginCacheDirPath() string {
+	pluginCacheDirMu.RLock()
+	dir := pluginCacheDir
+	pluginCacheDirMu.RUnlock()
+	if dir != "" {
+		return dir
+	}
+	return os.Getenv("TF_PLUGIN_CACHE_DIR")
+}
+
+// withPluginCacheLock runs fn while holding an exclusive file lock over the
+// plugin cache directory, so that concurrent installer processes (or
+// concurrent Runners in this one) sharing the same cache don't race while
+// terraform init populates it.
+func withPluginCacheLock(dir string, fn func() error) error {
+	if dir == "" {
+		return fn()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating plugin cache dir %s: %w", dir, err)
+	}
+
+	lock := flock.New(filepath.Join(dir, pluginCacheLockName))
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("locking plugin cache dir %s: %w", dir, err)
+	}
+	defer lock.Unlock()
+
+	return fn()
+}
+
+// Prewarm downloads the given provider source addresses (e.g.
+// "registry.terraform.io/hashicorp/aws") into the configured plugin cache
+// directory ahead of time, so that later Init calls against that cache can
+// proceed offline. It requires a plugin cache directory to be configured
+// via SetPluginCacheDir or TF_PLUGIN_CACHE_DIR.
+func Prewarm(providers []string, stdout, stderr io.Writer) error {
+	dir := pluginCacheDirPath()
+	if dir == "" {
+		return fmt.Errorf("no plugin cache directory configured; call SetPluginCacheDir or set TF_PLUGIN_CACHE_DIR")
+	}
+
+	return withPluginCacheLock(dir, func() error {
+		tmpDir, err := os.MkdirTemp("", "installer-prewarm")
+		if err != nil {
+			return fmt.Errorf("creating prewarm scratch dir: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if err := writePrewarmConfig(tmpDir, providers); err != nil {
+			return err
+		}
+
+		// terraform init takes its config directory as a positional
+		// argument, defaulting to the process's cwd when omitted; without
+		// passing tmpDir here init would read whatever config happens to
+		// be in the caller's cwd instead of prewarm.tf and silently
+		// download nothing.
+		//
+		// Run init directly rather than through Init/run's own
+		// withPluginCacheLock: this closure is already running under
+		// that same dir's lock, and flock does not nest within a
+		// process, so re-acquiring it here would deadlock forever.
+		if code := defaultRunner.initCacheLockHeld(tmpDir, []string{tmpDir}, stdout, stderr, DefaultRunOptions); code != 0 {
+			return fmt.Errorf("terraform init exited %d while prewarming plugin cache", code)
+		}
+		return nil
+	})
+}
+
+// writePrewarmConfig writes a throwaway Terraform configuration whose sole
+// purpose is to declare the requested providers so that `terraform init`
+// downloads them into the plugin cache.
+func writePrewarmConfig(dir string, providers []string) error {
+	f, err := os.Create(filepath.Join(dir, "prewarm.tf"))
+	if err != nil {
+		return fmt.Errorf("creating prewarm config: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, "terraform {")
+	fmt.Fprintln(f, "  required_providers {")
+	for i, p := range providers {
+		fmt.Fprintf(f, "    p%d = {\n      source = %q\n    }\n", i, p)
+	}
+	fmt.Fprintln(f, "  }")
+	fmt.Fprintln(f, "}")
+	return nil
+}
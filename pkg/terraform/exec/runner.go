@@ -0,0 +1,235 @@
+package exec
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/terraform/command"
+	"github.com/hashicorp/terraform/helper/logging"
+	"github.com/mitchellh/cli"
+)
+
+// logRouterOnce installs logRouter as the standard library's global `log`
+// package output exactly once, for the lifetime of the process. The
+// standard library logger has a single global destination, so there is no
+// way to give each concurrent invocation its own log.SetOutput target
+// without them stomping each other's; instead every active invocation
+// registers its logPipeline with logRouter and a single shared writer
+// broadcasts each captured line to all of them. This is what lets
+// f(meta).Run(args) execute fully concurrently across Runners: nothing
+// about log capture serializes a run anymore.
+var logRouterOnce sync.Once
+
+var logRouter = &logBroadcaster{pipelines: map[*logPipeline]struct{}{}}
+
+// logBroadcaster fans every line written to it out to all currently
+// registered logPipelines, since the stdlib logger gives no way to tell
+// which concurrent invocation produced a given line. This is a known
+// trade-off of running several Runners concurrently against the one
+// process-wide `log` destination the vendored Terraform/go-plugin code
+// writes through: a log line produced by one invocation can end up in
+// another concurrently-running invocation's crash buffer or LogHandler,
+// same as the direct os.Stderr writes neither this nor the prior
+// implementation captures. Isolating output would require the vendored
+// dependency to tag lines with an invocation identity, which it doesn't.
+type logBroadcaster struct {
+	mu        sync.Mutex
+	pipelines map[*logPipeline]struct{}
+}
+
+func (b *logBroadcaster) register(p *logPipeline) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pipelines[p] = struct{}{}
+}
+
+func (b *logBroadcaster) unregister(p *logPipeline) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pipelines, p)
+}
+
+func (b *logBroadcaster) Write(line []byte) (int, error) {
+	b.mu.Lock()
+	targets := make([]*logPipeline, 0, len(b.pipelines))
+	for p := range b.pipelines {
+		targets = append(targets, p)
+	}
+	b.mu.Unlock()
+
+	for _, p := range targets {
+		for _, l := range strings.Split(strings.TrimRight(string(line), "\n"), "\n") {
+			if l != "" {
+				p.handle(l)
+			}
+		}
+	}
+	return len(line), nil
+}
+
+// pluginCleanupRef counts invocations currently in flight. go-plugin's
+// CleanupClients kills every managed plugin client process-wide, so it is
+// only safe to call once no other Runner invocation might still be using
+// one; see the defer in run below. Under sustained, never-idle concurrent
+// use this can defer cleanup indefinitely rather than leaking it entirely
+// as calling it unconditionally would; go-plugin exposes no way to kill
+// only the clients a single invocation started.
+var (
+	pluginCleanupMu  sync.Mutex
+	pluginCleanupRef int
+)
+
+// Runner executes embedded Terraform subcommands. Unlike the package-level
+// Apply/Init/Destroy/Plan wrappers of older versions of this package, a
+// Runner keeps its own crash buffer and does not assume it is the only
+// invocation in flight, so multiple Runners (e.g. one per cluster being
+// installed) can be driven concurrently from the same process without
+// serializing the embedded Terraform execution itself. Log capture is
+// still routed through a single process-wide sink (see logBroadcaster),
+// so crash buffers and LogHandlers are isolated on a best-effort basis,
+// not guaranteed, under concurrent use.
+type Runner struct {
+	crashBuf *crashRingBuffer
+}
+
+// NewRunner creates a Runner ready to execute Terraform subcommands.
+func NewRunner() *Runner {
+	return &Runner{crashBuf: newCrashRingBuffer()}
+}
+
+// Apply is wrapper around `terraform apply` subcommand.
+func (r *Runner) Apply(datadir string, args []string, stdout, stderr io.Writer) int {
+	return r.run("apply", datadir, args, stdout, stderr, DefaultRunOptions, false)
+}
+
+// ApplyWithOptions is like Apply but allows the caller to customize log
+// capture via RunOptions.
+func (r *Runner) ApplyWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return r.run("apply", datadir, args, stdout, stderr, opts, false)
+}
+
+// Destroy is wrapper around `terraform destroy` subcommand.
+func (r *Runner) Destroy(datadir string, args []string, stdout, stderr io.Writer) int {
+	return r.run("destroy", datadir, args, stdout, stderr, DefaultRunOptions, false)
+}
+
+// DestroyWithOptions is like Destroy but allows the caller to customize log
+// capture via RunOptions.
+func (r *Runner) DestroyWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return r.run("destroy", datadir, args, stdout, stderr, opts, false)
+}
+
+// Init is wrapper around `terraform init` subcommand.
+func (r *Runner) Init(datadir string, args []string, stdout, stderr io.Writer) int {
+	return r.run("init", datadir, args, stdout, stderr, DefaultRunOptions, false)
+}
+
+// InitWithOptions is like Init but allows the caller to customize log
+// capture via RunOptions.
+func (r *Runner) InitWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return r.run("init", datadir, args, stdout, stderr, opts, false)
+}
+
+// initCacheLockHeld runs `terraform init` without taking the plugin cache
+// lock itself, for callers (namely Prewarm) that already hold it for the
+// same directory and would otherwise deadlock re-acquiring it.
+func (r *Runner) initCacheLockHeld(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) int {
+	return r.run("init", datadir, args, stdout, stderr, opts, true)
+}
+
+// Plan is wrapper around the `terraform plan` subcommand. See the
+// package-level Plan for details.
+func (r *Runner) Plan(datadir string, args []string, stdout, stderr io.Writer) (*PlanResult, int) {
+	return r.planWithOptions(datadir, args, stdout, stderr, DefaultRunOptions)
+}
+
+// PlanWithOptions is like Plan but allows the caller to customize log
+// capture via RunOptions.
+func (r *Runner) PlanWithOptions(datadir string, args []string, stdout, stderr io.Writer, opts RunOptions) (*PlanResult, int) {
+	return r.planWithOptions(datadir, args, stdout, stderr, opts)
+}
+
+// run is the shared implementation behind every Runner method. skipCacheLock
+// is set by initCacheLockHeld for callers that already hold the plugin
+// cache lock for this directory (namely Prewarm), so run doesn't re-acquire
+// it and deadlock.
+func (r *Runner) run(cmd string, dir string, args []string, stdout, stderr io.Writer, opts RunOptions, skipCacheLock bool) (retCode int) {
+	cancelAbortDump := installAbortDumpHandler(r.crashBuf)
+	defer cancelAbortDump()
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err := dumpCrashLog(r.crashBuf, rec); err != nil {
+				fmt.Fprintf(stderr, "error writing crash log: %v\n", err)
+			}
+			retCode = 1
+		}
+	}()
+
+	sdCh, cancel := makeShutdownCh()
+	defer cancel()
+
+	meta := command.Meta{
+		Color:            false,
+		GlobalPluginDirs: globalPluginDirs(stderr),
+		Ui: &cli.BasicUi{
+			Writer:      stdout,
+			ErrorWriter: stderr,
+		},
+
+		OverrideDataDir: dir,
+
+		ShutdownCh: sdCh,
+
+		PluginCacheDir: pluginCacheDirPath(),
+	}
+
+	// The pipeline always tees captured lines into the crash ring buffer,
+	// but only surfaces them (plain text, JSON or LogHandler) when TF_LOG,
+	// JSONLogs or a LogHandler was actually requested, matching the
+	// historical default of discarding Terraform's internal debug output.
+	emit := logging.LogLevel() != "" || opts.jsonLogsEnabled() || opts.LogHandler != nil
+	pipeline := newLogPipeline(opts, stderr, cmd, emit)
+	pipeline.crashBuf = r.crashBuf
+
+	logRouterOnce.Do(func() { log.SetOutput(logRouter) })
+	logRouter.register(pipeline)
+	defer logRouter.unregister(pipeline)
+
+	// go-plugin's CleanupClients kills every managed plugin client in the
+	// process, so it's only safe to run once no other Runner invocation
+	// might still be relying on one; defer it behind a refcount rather
+	// than calling it unconditionally on every return.
+	pluginCleanupMu.Lock()
+	pluginCleanupRef++
+	pluginCleanupMu.Unlock()
+	defer func() {
+		pluginCleanupMu.Lock()
+		pluginCleanupRef--
+		last := pluginCleanupRef == 0
+		pluginCleanupMu.Unlock()
+		if last {
+			plugin.CleanupClients()
+		}
+	}()
+
+	f := commands[cmd]
+
+	if cmd == "init" && meta.PluginCacheDir != "" && !skipCacheLock {
+		var code int
+		err := withPluginCacheLock(meta.PluginCacheDir, func() error {
+			code = f(meta).Run(args)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "error locking plugin cache: %v\n", err)
+			return 1
+		}
+		return code
+	}
+
+	return f(meta).Run(args)
+}